@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"container/list"
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,49 +22,210 @@ import (
 )
 
 func main() {
-	var (
-		verbose bool
-		prefix  string
-	)
-	flag.Usage = func() {
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "%s bucket-name RFC3339-timestamp\n", os.Args[0])
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
-		flag.PrintDefaults()
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Example: %s -verbose mybucket \"2023-08-17T18:50:00+02:00\"\n\n", os.Args[0])
-	}
-	flag.BoolVar(&verbose, "verbose", false, "print debug information")
-	flag.StringVar(&prefix, "prefix", "", "only work on a given prefix")
-	flag.Parse()
-	if len(flag.Args()) != 2 {
-		flag.Usage()
-		os.Exit(2)
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		restoreCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		purgeCommand(os.Args[2:])
+		return
 	}
+	timestampCommand(os.Args[1:])
+}
 
-	ctx := context.Background()
+// configureLogging installs the default slog handler used by every
+// subcommand, at debug level when verbose is set.
+func configureLogging(verbose bool) {
 	logLevel := slog.LevelInfo
 	if verbose {
 		logLevel = slog.LevelDebug
 	}
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+}
 
-	bucket := flag.Args()[0]
-	referenceTimestamp, err := time.Parse(time.RFC3339, flag.Args()[1])
-	if err != nil {
-		slog.ErrorContext(ctx, "invalid timestamp:", "err", err)
-		os.Exit(1)
+// timestampCommand is the original, default mode of operation: restore an
+// entire bucket to the state it had at a given RFC3339 timestamp. Passing
+// -versions switches it to a listing mode that prints every key and version
+// instead of restoring anything.
+func timestampCommand(args []string) {
+	fs := flag.NewFlagSet("s3-version-restore", flag.ExitOnError)
+	var (
+		verbose      bool
+		prefix       string
+		concurrency  int
+		versionsMode bool
+		dryRun       bool
+		planFormat   string
+		planOut      string
+		applyPlan    string
+		statePath    string
+		resume       bool
+	)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage of %s:\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s [flags] bucket-name RFC3339-timestamp\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s -versions [flags] bucket-name\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s -apply plan.json [flags] bucket-name\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s restore [flags] bucket-name [key@versionId ...]\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s purge [flags] bucket-name\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "Flags:\n")
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(fs.Output(), "Example: %s -verbose mybucket \"2023-08-17T18:50:00+02:00\"\n\n", os.Args[0])
+	}
+	fs.BoolVar(&verbose, "verbose", false, "print debug information")
+	fs.StringVar(&prefix, "prefix", "", "only work on a given prefix")
+	fs.IntVar(&concurrency, "concurrency", 1, "number of keys to restore in parallel (deletes are batched instead)")
+	fs.BoolVar(&versionsMode, "versions", false, "list every key and version instead of restoring; only the bucket-name argument is required")
+	fs.BoolVar(&dryRun, "dry-run", false, "compute and print a plan of intended actions instead of applying them")
+	fs.StringVar(&planFormat, "plan-format", "json", "plan output format when -dry-run is set: json or csv")
+	fs.StringVar(&planOut, "plan-out", "-", "where to write the plan when -dry-run is set (- for stdout)")
+	fs.StringVar(&applyPlan, "apply", "", "execute exactly the actions in a previously saved JSON plan file, instead of computing one from bucket+timestamp")
+	fs.StringVar(&statePath, "state", "", "checkpoint listing progress to this file after each processed key, so a later run can -resume")
+	fs.BoolVar(&resume, "resume", false, "continue a listing previously checkpointed to -state instead of starting from the beginning of the bucket")
+	_ = fs.Parse(args)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	wantArgs := 2
+	if versionsMode || applyPlan != "" {
+		wantArgs = 1
+	}
+	if fs.NArg() != wantArgs {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if resume && statePath == "" {
+		fmt.Fprintln(fs.Output(), "-resume requires -state to be set")
+		os.Exit(2)
 	}
 
+	ctx := context.Background()
+	configureLogging(verbose)
+
+	bucket := fs.Arg(0)
+
 	s3Client, err := s3.New(ctx)
 	if err != nil {
 		slog.ErrorContext(ctx, "could not initialize s3 client:", "err", err)
 		os.Exit(1)
 	}
-	versionIt, err := s3Client.List(ctx, bucket, nil)
+
+	if versionsMode {
+		if err := listVersions(ctx, s3Client, bucket, prefix); err != nil {
+			slog.ErrorContext(ctx, "could not list versions", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if applyPlan != "" {
+		applyPlanFile(ctx, s3Client, bucket, applyPlan, concurrency)
+		return
+	}
+
+	referenceTimestamp, err := time.Parse(time.RFC3339, fs.Arg(1))
 	if err != nil {
-		slog.ErrorContext(ctx, "could not list versions", "err", err)
+		slog.ErrorContext(ctx, "invalid timestamp:", "err", err)
 		os.Exit(1)
 	}
+
+	var prefixArg *string
+	if prefix != "" {
+		prefixArg = &prefix
+	}
+
+	var versionIt s3.ListIterator
+	if resume {
+		savedState, err := loadState(statePath)
+		if err != nil {
+			slog.ErrorContext(ctx, "could not load checkpoint", "path", statePath, "err", err)
+			os.Exit(1)
+		}
+		slog.InfoContext(ctx, "resuming", "state", statePath, "after_key", savedState.LastKey)
+		versionIt, err = s3Client.Resume(ctx, savedState)
+		if err != nil {
+			slog.ErrorContext(ctx, "could not resume listing", "err", err)
+			os.Exit(1)
+		}
+	} else {
+		versionIt, err = s3Client.List(ctx, bucket, prefixArg)
+		if err != nil {
+			slog.ErrorContext(ctx, "could not list versions", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if dryRun {
+		// versionIt is already scoped to -prefix above, so the plan an operator
+		// reviews here covers exactly what -apply would later touch.
+		var plan s3.Plan
+		for {
+			key, versions, err := versionIt.Next(ctx)
+			if errors.Is(err, io.EOF) {
+				break // done
+			} else if err != nil {
+				slog.ErrorContext(ctx, "could not list versions", "err", err)
+				os.Exit(1)
+			}
+			plan = append(plan, planKey(key, versions, referenceTimestamp))
+		}
+		if err := writePlan(plan, planFormat, planOut); err != nil {
+			slog.ErrorContext(ctx, "could not write plan", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	checkpoint := newCheckpointer(statePath)
+
+	jobs := make(chan restoreJob)
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := applyPlanEntry(ctx, s3Client, bucket, job.entry); err != nil {
+					slog.Error("could not process object", "key", job.entry.Key, "err", err)
+					failed.Store(true)
+					continue
+				}
+				checkpoint.complete(job.pending)
+			}
+		}()
+	}
+
+	var deleteBatch []pendingDelete
+	flushDeletes := func() {
+		if len(deleteBatch) == 0 {
+			return
+		}
+		keys := make([]string, len(deleteBatch))
+		for i, pd := range deleteBatch {
+			keys[i] = pd.key
+		}
+		slog.InfoContext(ctx, "batch deleting", "count", len(keys))
+		failedKeys, err := s3Client.DeleteMany(ctx, bucket, keys)
+		if err != nil {
+			slog.Error("could not batch delete objects", "err", err)
+			failed.Store(true)
+		} else {
+			failedKeySet := make(map[string]bool, len(failedKeys))
+			for _, key := range failedKeys {
+				failedKeySet[key] = true
+			}
+			for _, pd := range deleteBatch {
+				if failedKeySet[pd.key] {
+					failed.Store(true)
+					continue
+				}
+				checkpoint.complete(pd.pending)
+			}
+		}
+		deleteBatch = deleteBatch[:0]
+	}
+
 	for {
 		key, versions, err := versionIt.Next(ctx)
 		if errors.Is(err, io.EOF) {
@@ -66,43 +234,547 @@ func main() {
 			slog.ErrorContext(ctx, "could not list versions", "err", err)
 			os.Exit(1)
 		}
-		slog.Debug("checking", "key", key, "versions", versions)
-		var versionAtTimestamp s3.ObjectVersion
-		var latestVersion s3.ObjectVersion
-		for _, v := range versions {
-			if v.Timestamp.Before(referenceTimestamp) {
-				versionAtTimestamp = v
-			}
-			if v.IsLatest {
-				latestVersion = v
+		pending := checkpoint.enqueue(versionIt.Checkpoint(key))
+		entry := planKey(key, versions, referenceTimestamp)
+		switch entry.Action {
+		case s3.PlanActionSkip:
+			slog.InfoContext(ctx, "skipping", "key", entry.Key, "etag", entry.ETag)
+			checkpoint.complete(pending)
+		case s3.PlanActionDelete:
+			// batched via DeleteMany below instead of one DeleteObject call per key
+			deleteBatch = append(deleteBatch, pendingDelete{key: key, pending: pending})
+			if len(deleteBatch) >= deleteBatchSize {
+				flushDeletes()
 			}
+		default:
+			jobs <- restoreJob{entry: entry, pending: pending}
+		}
+	}
+	flushDeletes()
+	close(jobs)
+	wg.Wait()
+
+	if failed.Load() {
+		os.Exit(1)
+	}
+}
+
+// restoreJob is the unit of work handed to the worker pool: a precomputed
+// plan entry (always a restore by the time it reaches here) and the
+// checkpointer token to mark complete once it has been successfully
+// applied. Deletes skip this pool entirely and are batched via DeleteMany.
+type restoreJob struct {
+	entry   s3.PlanEntry
+	pending *list.Element
+}
+
+// pendingDelete pairs a key queued for batch deletion with the checkpointer
+// token to complete once the DeleteMany call it was part of succeeds.
+type pendingDelete struct {
+	key     string
+	pending *list.Element
+}
+
+// deleteBatchSize mirrors S3's DeleteObjects limit (and s3.DeleteMany's own
+// internal chunking), so flushing here bounds how many keys can be waiting
+// on one batch without changing how many objects end up in a single API
+// call.
+const deleteBatchSize = 1000
+
+// checkpointer persists IteratorState to a file as keys finish processing.
+// With -concurrency > 1, workers complete out of order, so a naive
+// "keep the highest key seen" guard is unsafe: it would let a checkpoint
+// past a key that is still in flight, and a crash at that point would make
+// -resume skip it. Instead, checkpointer keeps every in-flight key in the
+// order it was listed and only advances the persisted checkpoint past the
+// longest prefix of that order that has actually completed.
+type checkpointer struct {
+	path    string
+	mu      sync.Mutex
+	pending *list.List // of *pendingState, oldest (first listed) at the front
+}
+
+type pendingState struct {
+	state s3.IteratorState
+	done  bool
+}
+
+func newCheckpointer(path string) *checkpointer {
+	return &checkpointer{path: path, pending: list.New()}
+}
+
+// enqueue registers a key about to be processed, preserving listing order,
+// and returns a token to pass to complete once it finishes. Returns nil if
+// no -state path was given, since there is then nothing to track.
+func (c *checkpointer) enqueue(state s3.IteratorState) *list.Element {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending.PushBack(&pendingState{state: state})
+}
+
+// complete marks elem's key as finished and, if it is now the oldest
+// unfinished entry, persists the checkpoint as of the last entry in the
+// contiguous run of completed keys starting at the front of the queue. A
+// key still in flight always blocks the checkpoint from advancing past it.
+func (c *checkpointer) complete(elem *list.Element) {
+	if elem == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem.Value.(*pendingState).done = true
+
+	var frontier s3.IteratorState
+	advanced := false
+	for front := c.pending.Front(); front != nil && front.Value.(*pendingState).done; front = c.pending.Front() {
+		frontier = front.Value.(*pendingState).state
+		advanced = true
+		c.pending.Remove(front)
+	}
+	if !advanced {
+		return
+	}
+	if err := writeState(c.path, frontier); err != nil {
+		slog.Error("could not persist checkpoint", "path", c.path, "err", err)
+	}
+}
+
+// writeState saves state to path, writing to a temporary file first and
+// renaming it into place so a crash mid-write cannot corrupt the checkpoint
+// a -resume run would read.
+func writeState(path string, state s3.IteratorState) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "creating checkpoint file")
+	}
+	enc := json.NewEncoder(f)
+	encErr := enc.Encode(state)
+	closeErr := f.Close()
+	if encErr != nil {
+		return errors.Wrap(encErr, "encoding checkpoint")
+	}
+	if closeErr != nil {
+		return errors.Wrap(closeErr, "closing checkpoint file")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "installing checkpoint file")
+}
+
+// loadState reads back a checkpoint previously written by writeState, for
+// -resume.
+func loadState(path string) (s3.IteratorState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return s3.IteratorState{}, errors.Wrap(err, "opening checkpoint file")
+	}
+	defer f.Close()
+	var state s3.IteratorState
+	err = json.NewDecoder(f).Decode(&state)
+	return state, errors.Wrap(err, "decoding checkpoint")
+}
+
+// planKey decides what should happen to key to bring it to the state it had
+// at referenceTimestamp, without touching the bucket. It is shared by the
+// dry-run plan computation and the real restore path, so the two can never
+// disagree about what "restoring" means.
+func planKey(key string, versions []s3.ObjectVersion, referenceTimestamp time.Time) s3.PlanEntry {
+	slog.Debug("checking", "key", key, "versions", versions)
+	var versionAtTimestamp s3.ObjectVersion
+	var latestVersion s3.ObjectVersion
+	for _, v := range versions {
+		if v.Timestamp.Before(referenceTimestamp) {
+			versionAtTimestamp = v
+		}
+		if v.IsLatest {
+			latestVersion = v
 		}
+	}
 
-		if latestVersion.ETag == versionAtTimestamp.ETag {
-			slog.InfoContext(ctx, "skipping", "key", key, "etag", versionAtTimestamp.ETag)
-			continue // already at the state we want, nothing to do
+	if latestVersion.ETag == versionAtTimestamp.ETag {
+		return s3.PlanEntry{Key: key, Action: s3.PlanActionSkip, ETag: versionAtTimestamp.ETag}
+	}
+
+	// 3 things can happen at referenceTimestamp:
+	// - file did not exist (no previous PUT) --> delete
+	// - file had an active version (a previous PUT) --> copy
+	// - file had been deleted (a previous DELETE) --> delete
+	if versionAtTimestamp == s3.ZeroObjectVersion || versionAtTimestamp.Operation == s3.OperationTypeDelete {
+		return s3.PlanEntry{Key: key, Action: s3.PlanActionDelete}
+	}
+	return s3.PlanEntry{Key: key, Action: s3.PlanActionRestore, SourceVersionID: versionAtTimestamp.VersionID, ETag: versionAtTimestamp.ETag}
+}
+
+// applyPlanEntry executes a single plan entry against bucket. Keys are
+// independent of each other, so this is safe to call concurrently for
+// different keys while preserving the "one new version per key" semantics.
+//
+// Both callers (timestampCommand and applyPlanFile) filter PlanActionDelete
+// entries out before handing work to applyPlanEntry, routing them through
+// DeleteMany instead so deletes are batched rather than one DeleteObject call
+// per key. The case below is kept so applyPlanEntry remains correct as a
+// generic single-entry executor for any PlanEntry, not just the restore and
+// skip entries its current callers send it.
+func applyPlanEntry(ctx context.Context, s3Client *s3.Client, bucket string, entry s3.PlanEntry) error {
+	switch entry.Action {
+	case s3.PlanActionSkip:
+		slog.InfoContext(ctx, "skipping", "key", entry.Key, "etag", entry.ETag)
+		return nil // already at the state we want, nothing to do
+	case s3.PlanActionDelete:
+		slog.InfoContext(ctx, "deleting", "key", entry.Key)
+		// delete the latest version of the object, this preserves history
+		if err := s3Client.Delete(ctx, bucket, entry.Key); err != nil {
+			return errors.Wrap(err, "could not delete object: "+entry.Key)
+		}
+	case s3.PlanActionRestore:
+		slog.InfoContext(ctx, "restoring", "key", entry.Key, "version", entry.SourceVersionID)
+		// copy the desired version of the object as last, this preserves history
+		if err := s3Client.Copy(ctx, bucket, bucket, entry.Key, entry.SourceVersionID); err != nil {
+			return errors.Wrap(err, "could not restore object version "+entry.SourceVersionID+": "+entry.Key)
+		}
+	default:
+		return errors.Errorf("unknown plan action %q for key %q", entry.Action, entry.Key)
+	}
+	return nil
+}
+
+// writePlan writes plan in the requested format (json or csv) to out, which
+// may be a file path or "-" for stdout.
+func writePlan(plan s3.Plan, format string, out string) error {
+	w := io.Writer(os.Stdout)
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			return errors.Wrap(err, "creating plan file")
 		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case "json":
+		return plan.WriteJSON(w)
+	case "csv":
+		return plan.WriteCSV(w)
+	default:
+		return errors.Errorf("unknown plan format %q, want json or csv", format)
+	}
+}
+
+// applyPlanFile reads a plan previously saved with -dry-run and executes it
+// exactly. DELETE entries are batched through a single DeleteMany call that
+// runs concurrently with the worker pool handling every other entry, so a
+// large batch of deletes doesn't serialize in front of the restores.
+func applyPlanFile(ctx context.Context, s3Client *s3.Client, bucket string, path string, concurrency int) {
+	f, err := os.Open(path)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not open plan", "path", path, "err", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	plan, err := s3.ReadPlan(f)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not read plan", "path", path, "err", err)
+		os.Exit(1)
+	}
 
-		// 3 things can happen at referenceTimestamp:
-		// - file did not exist (no previous PUT) --> delete
-		// - file had an active version (a previous PUT) --> copy
-		// - file had been deleted (a previous DELETE) --> delete
-		if versionAtTimestamp == s3.ZeroObjectVersion || versionAtTimestamp.Operation == s3.OperationTypeDelete { // delete
-			slog.InfoContext(ctx, "deleting", "key", key, "version", versionAtTimestamp.VersionID)
-			// delete the latest version of the object, this preserves history
-			err := s3Client.Delete(ctx, bucket, key)
+	var failed atomic.Bool
+	var deleteKeys []string
+	var other []s3.PlanEntry
+	for _, entry := range plan {
+		if entry.Action == s3.PlanActionDelete {
+			deleteKeys = append(deleteKeys, entry.Key)
+			continue
+		}
+		other = append(other, entry)
+	}
+	jobs := make(chan s3.PlanEntry)
+	var wg sync.WaitGroup
+	if len(deleteKeys) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.InfoContext(ctx, "batch deleting", "count", len(deleteKeys))
+			failedKeys, err := s3Client.DeleteMany(ctx, bucket, deleteKeys)
 			if err != nil {
-				slog.Error("could not delete object", "key", key, "err", err)
-				os.Exit(1)
+				slog.Error("could not batch delete objects", "err", err)
+				failed.Store(true)
+			} else if len(failedKeys) > 0 {
+				slog.Error("could not delete some objects", "count", len(failedKeys))
+				failed.Store(true)
 			}
-		} else { // restore
-			slog.InfoContext(ctx, "restoring", "key", key, "version", versionAtTimestamp.VersionID)
-			// copy the desired version of the object as last, this preserves history
-			err := s3Client.Copy(ctx, bucket, bucket, key, versionAtTimestamp.VersionID)
-			if err != nil {
-				slog.Error("could not restore object", "key", key, "version", versionAtTimestamp.VersionID, "err", err)
-				os.Exit(1)
+		}()
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				if err := applyPlanEntry(ctx, s3Client, bucket, entry); err != nil {
+					slog.Error("could not apply plan entry", "key", entry.Key, "err", err)
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for _, entry := range other {
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+
+	if failed.Load() {
+		os.Exit(1)
+	}
+}
+
+// listVersions prints every key in the bucket together with each of its
+// versions, one per line, as CSV "key,versionId,syntheticKey". The first two
+// fields are themselves a valid restore manifest line, so a listing can be
+// filtered down (e.g. with grep/awk) and piped straight into
+// "restore -manifest -" for surgical restores. Real CSV quoting is used
+// (rather than a plain Fprintf) so keys containing a comma round-trip
+// correctly through loadVersionSelectors.
+func listVersions(ctx context.Context, s3Client *s3.Client, bucket string, prefix string) error {
+	var prefixArg *string
+	if prefix != "" {
+		prefixArg = &prefix
+	}
+	versionIt, err := s3Client.List(ctx, bucket, prefixArg)
+	if err != nil {
+		return errors.Wrap(err, "listing versions")
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer func() { _ = w.Flush() }()
+	cw := csv.NewWriter(w)
+	for {
+		key, versions, err := versionIt.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			cw.Flush()
+			return errors.Wrap(cw.Error(), "writing version listing")
+		} else if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			if err := cw.Write([]string{key, v.VersionID, s3.SyntheticKey(key, v)}); err != nil {
+				return errors.Wrap(err, "writing version listing")
 			}
 		}
 	}
 }
+
+// restoreCommand implements the "restore" subcommand: it restores a set of
+// explicitly chosen key/version pairs instead of restoring an entire bucket
+// to a single timestamp. Selectors can be given as key@versionId arguments,
+// or loaded in bulk from a -manifest file of "key,versionId" CSV lines.
+func restoreCommand(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var (
+		verbose  bool
+		manifest string
+	)
+	fs.BoolVar(&verbose, "verbose", false, "print debug information")
+	fs.StringVar(&manifest, "manifest", "", "path to a CSV file of key,versionId pairs to restore (use - for stdin)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage of %s restore:\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s restore [flags] bucket-name [key@versionId ...]\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	bucket := fs.Arg(0)
+
+	ctx := context.Background()
+	configureLogging(verbose)
+
+	selectors, err := loadVersionSelectors(manifest, fs.Args()[1:])
+	if err != nil {
+		slog.ErrorContext(ctx, "could not load version selectors", "err", err)
+		os.Exit(1)
+	}
+	if len(selectors) == 0 {
+		slog.ErrorContext(ctx, "no key@versionId selectors given, and -manifest is empty")
+		os.Exit(2)
+	}
+
+	s3Client, err := s3.New(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not initialize s3 client:", "err", err)
+		os.Exit(1)
+	}
+
+	var failed bool
+	for _, sel := range selectors {
+		slog.InfoContext(ctx, "restoring", "key", sel.key, "version", sel.versionID)
+		if err := s3Client.Copy(ctx, bucket, bucket, sel.key, sel.versionID); err != nil {
+			slog.Error("could not restore object", "key", sel.key, "version", sel.versionID, "err", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// versionSelector names a single version of a single key to restore.
+type versionSelector struct {
+	key       string
+	versionID string
+}
+
+// loadVersionSelectors builds the list of versions to restore from
+// key@versionId command-line arguments and/or a manifest file of
+// "key,versionId" CSV lines (trailing fields, such as the synthetic key
+// produced by listVersions, are ignored). S3 version IDs never contain "@",
+// but keys can, so each selector is split on the last "@" rather than the
+// first. The manifest is read as real CSV, matching how listVersions writes
+// it, so a key containing a comma round-trips correctly instead of being
+// split apart.
+func loadVersionSelectors(manifestPath string, args []string) ([]versionSelector, error) {
+	selectors := make([]versionSelector, 0, len(args))
+	for _, arg := range args {
+		idx := strings.LastIndex(arg, "@")
+		if idx < 0 {
+			return nil, errors.Errorf("invalid selector %q, expected key@versionId", arg)
+		}
+		selectors = append(selectors, versionSelector{key: arg[:idx], versionID: arg[idx+1:]})
+	}
+	if manifestPath == "" {
+		return selectors, nil
+	}
+
+	r := os.Stdin
+	if manifestPath != "-" {
+		f, err := os.Open(manifestPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening manifest")
+		}
+		defer f.Close()
+		r = f
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "reading manifest")
+		}
+		if len(fields) < 2 {
+			return nil, errors.Errorf("invalid manifest line %q, expected key,versionId", strings.Join(fields, ","))
+		}
+		selectors = append(selectors, versionSelector{key: fields[0], versionID: fields[1]})
+	}
+	return selectors, nil
+}
+
+// purgeCommand implements the "purge" subcommand: it permanently removes
+// every version and delete marker of every key in a bucket (optionally
+// restricted to a prefix), unlike the other commands which only ever add a
+// new version. A purge cannot be undone; -dry-run logs what would be deleted
+// without deleting anything, so the target can be checked first.
+func purgeCommand(args []string) {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	var (
+		verbose      bool
+		prefix       string
+		dryRun       bool
+		deleteBucket bool
+	)
+	fs.BoolVar(&verbose, "verbose", false, "print debug information")
+	fs.StringVar(&prefix, "prefix", "", "only purge a given prefix")
+	fs.BoolVar(&dryRun, "dry-run", false, "log what would be deleted without deleting anything")
+	fs.BoolVar(&deleteBucket, "delete-bucket", false, "delete the bucket itself once every version is gone")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage of %s purge:\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "%s purge [flags] bucket-name\n", os.Args[0])
+		_, _ = fmt.Fprintf(fs.Output(), "Flags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	bucket := fs.Arg(0)
+
+	ctx := context.Background()
+	configureLogging(verbose)
+
+	s3Client, err := s3.New(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not initialize s3 client:", "err", err)
+		os.Exit(1)
+	}
+
+	var prefixArg *string
+	if prefix != "" {
+		prefixArg = &prefix
+	}
+	versionIt, err := s3Client.List(ctx, bucket, prefixArg)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not list versions", "err", err)
+		os.Exit(1)
+	}
+
+	var failed bool
+	batch := make([]s3.ObjectVersionRef, 0, maxPurgeBatchSize)
+	flushBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if dryRun {
+			for _, ref := range batch {
+				slog.InfoContext(ctx, "would delete", "key", ref.Key, "version", ref.VersionID)
+			}
+		} else if failedRefs, err := s3Client.DeleteVersions(ctx, bucket, batch); err != nil {
+			slog.Error("could not delete object versions", "err", err)
+			failed = true
+		} else if len(failedRefs) > 0 {
+			failed = true
+		}
+		batch = batch[:0]
+	}
+	for {
+		key, versions, err := versionIt.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			slog.ErrorContext(ctx, "could not list versions", "err", err)
+			os.Exit(1)
+		}
+		for _, v := range versions {
+			batch = append(batch, s3.ObjectVersionRef{Key: key, VersionID: v.VersionID})
+			if len(batch) == maxPurgeBatchSize {
+				flushBatch()
+			}
+		}
+	}
+	flushBatch()
+
+	if failed {
+		os.Exit(1)
+	}
+
+	if deleteBucket {
+		if dryRun {
+			slog.InfoContext(ctx, "would delete bucket", "bucket", bucket)
+			return
+		}
+		slog.InfoContext(ctx, "deleting bucket", "bucket", bucket)
+		if err := s3Client.DeleteBucket(ctx, bucket); err != nil {
+			slog.ErrorContext(ctx, "could not delete bucket", "bucket", bucket, "err", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// maxPurgeBatchSize mirrors S3's DeleteObjects limit so purgeCommand can
+// stream arbitrarily large buckets without holding every version in memory.
+const maxPurgeBatchSize = 1000
@@ -7,15 +7,22 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/pkg/errors"
 )
 
+// maxKeysPerBatchDelete is the maximum number of objects S3's DeleteObjects
+// API accepts in a single request.
+const maxKeysPerBatchDelete = 1000
+
 type Client struct {
 	c *s3.Client
 }
@@ -107,6 +114,45 @@ func (c *Client) List(ctx context.Context, bucket string, prefix *string) (ListI
 	}, nil
 }
 
+// IteratorState is the part of a ListIterator's progress that can be
+// persisted to disk and later handed to Resume, so a long-running listing
+// can survive a restart instead of re-listing the bucket from the start.
+// KeyMarker/VersionIdMarker are recorded for visibility only: they are the
+// NextKeyMarker/NextVersionIdMarker of the most recently loaded page, which
+// point past keys the iterator may not have handed out yet. Resume always
+// positions from LastKey, the key the caller actually finished processing,
+// so a crash partway through a page can't skip the rest of it.
+type IteratorState struct {
+	Bucket          string  `json:"bucket"`
+	Prefix          *string `json:"prefix,omitempty"`
+	KeyMarker       *string `json:"keyMarker,omitempty"`
+	VersionIdMarker *string `json:"versionIdMarker,omitempty"`
+	LastKey         string  `json:"lastKey,omitempty"`
+}
+
+// Resume needs s3:ListBucketVersions permission, like List. It reopens a
+// ListIterator positioned right after state.LastKey, the key the caller
+// confirms it finished processing, rather than the saved page markers:
+// those point to the end of the page LastKey was read from, and using them
+// directly would silently skip any keys after LastKey but still in that
+// page. If LastKey is empty (nothing processed yet), listing starts from
+// the beginning of the bucket.
+func (c *Client) Resume(ctx context.Context, state IteratorState) (ListIterator, error) {
+	var keyMarker *string
+	if state.LastKey != "" {
+		keyMarker = aws.String(state.LastKey)
+	}
+	return ListIterator{
+		c:                       c,
+		bucket:                  state.Bucket,
+		prefix:                  state.Prefix,
+		loadMore:                true,
+		keyMarker:               keyMarker,
+		versionIdMarker:         nil,
+		pageObjectsWithVersions: make(ObjectVersionMap),
+	}, nil
+}
+
 type ListIterator struct {
 	c                       *Client
 	bucket                  string
@@ -117,6 +163,20 @@ type ListIterator struct {
 	pageObjectsWithVersions ObjectVersionMap
 }
 
+// Checkpoint captures lastKey, the key the caller confirms it finished
+// processing, together with the iterator's current paging markers (kept for
+// visibility only, see IteratorState), as a state that can be persisted and
+// later passed to Resume.
+func (it *ListIterator) Checkpoint(lastKey string) IteratorState {
+	return IteratorState{
+		Bucket:          it.bucket,
+		Prefix:          it.prefix,
+		KeyMarker:       it.keyMarker,
+		VersionIdMarker: it.versionIdMarker,
+		LastKey:         lastKey,
+	}
+}
+
 func (it *ListIterator) Next(ctx context.Context) (string, []ObjectVersion, error) {
 	// we know objects are sorted alphabetically, therefore it is safe to read the first element when we have more than one
 	for it.loadMore && len(it.pageObjectsWithVersions) <= 1 {
@@ -156,6 +216,25 @@ func (it *ListIterator) Next(ctx context.Context) (string, []ObjectVersion, erro
 	return key, versions, nil
 }
 
+// syntheticVersionIDLength is how many characters of a version ID are kept
+// when building a synthetic key, enough to disambiguate versions by eye
+// without making listings unwieldy.
+const syntheticVersionIDLength = 6
+
+// SyntheticKey formats key and one of its versions as a single pipeable
+// string such as "name-v2023-08-17-165000-abc123.ext", embedding the
+// version's timestamp and a short prefix of its version ID. It is meant for
+// previewing or piping `-versions` listings, not for use as a real S3 key.
+func SyntheticKey(key string, v ObjectVersion) string {
+	ext := path.Ext(key)
+	base := strings.TrimSuffix(key, ext)
+	shortID := v.VersionID
+	if len(shortID) > syntheticVersionIDLength {
+		shortID = shortID[:syntheticVersionIDLength]
+	}
+	return fmt.Sprintf("%s-v%s-%s%s", base, v.Timestamp.Format("2006-01-02-150405"), shortID, ext)
+}
+
 func firstMapKey[K cmp.Ordered, V any](m map[K]V) K {
 	if len(m) == 0 {
 		panic("map is empty")
@@ -185,3 +264,78 @@ func (c *Client) Delete(ctx context.Context, bucket string, key string) error {
 	})
 	return errors.Wrap(err, "deleting object: "+key)
 }
+
+// DeleteMany deletes the given keys using S3's batch DeleteObjects API,
+// chunking the request into groups of at most 1000 keys as required by the
+// API. No version IDs are sent, so on a versioned bucket each key only gets a
+// new delete marker and its history is kept. Per-object failures don't abort
+// the remaining chunks; callers generally need to know exactly which keys
+// didn't go away (e.g. to avoid checkpointing past them), so those keys are
+// logged and also returned in failedKeys. err is only set if a chunk-level
+// request itself failed.
+func (c *Client) DeleteMany(ctx context.Context, bucket string, keys []string) (failedKeys []string, err error) {
+	for start := 0; start < len(keys); start += maxKeysPerBatchDelete {
+		chunk := keys[start:min(start+maxKeysPerBatchDelete, len(keys))]
+		objects := make([]types.ObjectIdentifier, len(chunk))
+		for i, key := range chunk {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		out, err := c.c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &bucket,
+			Delete: &types.Delete{Objects: objects},
+		})
+		if err != nil {
+			return failedKeys, errors.Wrap(err, "batch deleting objects")
+		}
+		for _, objErr := range out.Errors {
+			slog.Error("could not delete object", "key", aws.ToString(objErr.Key), "code", aws.ToString(objErr.Code), "message", aws.ToString(objErr.Message))
+			failedKeys = append(failedKeys, aws.ToString(objErr.Key))
+		}
+	}
+	return failedKeys, nil
+}
+
+// ObjectVersionRef identifies a single version (or delete marker) of a key,
+// as required to permanently remove it with DeleteVersions.
+type ObjectVersionRef struct {
+	Key       string
+	VersionID string
+}
+
+// DeleteVersions permanently removes the given versions (including delete
+// markers) using S3's batch DeleteObjects API with explicit VersionId
+// entries, chunking at 1000 per call like DeleteMany. Unlike DeleteMany,
+// which only adds a delete marker on a versioned bucket, this actually
+// removes history and is what purging a bucket requires. Mirrors
+// DeleteMany's contract: per-object failures are logged and also returned in
+// failed, so a caller like purgeCommand can tell a partially-failed purge
+// from a complete one instead of exiting 0 either way.
+func (c *Client) DeleteVersions(ctx context.Context, bucket string, refs []ObjectVersionRef) (failed []ObjectVersionRef, err error) {
+	for start := 0; start < len(refs); start += maxKeysPerBatchDelete {
+		chunk := refs[start:min(start+maxKeysPerBatchDelete, len(refs))]
+		objects := make([]types.ObjectIdentifier, len(chunk))
+		for i, ref := range chunk {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(ref.Key), VersionId: aws.String(ref.VersionID)}
+		}
+		out, err := c.c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &bucket,
+			Delete: &types.Delete{Objects: objects},
+		})
+		if err != nil {
+			return failed, errors.Wrap(err, "batch deleting object versions")
+		}
+		for _, objErr := range out.Errors {
+			slog.Error("could not delete object version", "key", aws.ToString(objErr.Key), "version", aws.ToString(objErr.VersionId), "code", aws.ToString(objErr.Code), "message", aws.ToString(objErr.Message))
+			failed = append(failed, ObjectVersionRef{Key: aws.ToString(objErr.Key), VersionID: aws.ToString(objErr.VersionId)})
+		}
+	}
+	return failed, nil
+}
+
+// DeleteBucket deletes the bucket itself. It only succeeds once every
+// version and delete marker has already been removed, e.g. via
+// DeleteVersions.
+func (c *Client) DeleteBucket(ctx context.Context, bucket string) error {
+	_, err := c.c.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: &bucket})
+	return errors.Wrap(err, "deleting bucket: "+bucket)
+}
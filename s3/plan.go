@@ -0,0 +1,62 @@
+package s3
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// PlanAction is the action the tool intends to take for a single key.
+type PlanAction string
+
+var (
+	PlanActionSkip    PlanAction = "SKIP"
+	PlanActionDelete  PlanAction = "DELETE"
+	PlanActionRestore PlanAction = "RESTORE"
+)
+
+// PlanEntry is one line of a Plan: the action the tool would take for Key,
+// and, for a RESTORE, which version it would copy from.
+type PlanEntry struct {
+	Key             string     `json:"key"`
+	Action          PlanAction `json:"action"`
+	SourceVersionID string     `json:"sourceVersionId,omitempty"`
+	ETag            string     `json:"etag,omitempty"`
+}
+
+// Plan is the set of actions a dry run would take, so operators can review
+// it before anything is mutated and replay it exactly later with -apply.
+type Plan []PlanEntry
+
+// WriteJSON writes the plan as a single indented JSON array.
+func (p Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(p), "encoding plan as JSON")
+}
+
+// WriteCSV writes the plan as CSV with a header row, for review in a
+// spreadsheet.
+func (p Plan) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"key", "action", "sourceVersionId", "etag"}); err != nil {
+		return errors.Wrap(err, "encoding plan as CSV")
+	}
+	for _, entry := range p {
+		if err := cw.Write([]string{entry.Key, string(entry.Action), entry.SourceVersionID, entry.ETag}); err != nil {
+			return errors.Wrap(err, "encoding plan as CSV")
+		}
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "encoding plan as CSV")
+}
+
+// ReadPlan reads back a plan previously written with WriteJSON, as consumed
+// by -apply.
+func ReadPlan(r io.Reader) (Plan, error) {
+	var p Plan
+	err := json.NewDecoder(r).Decode(&p)
+	return p, errors.Wrap(err, "decoding plan")
+}